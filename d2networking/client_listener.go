@@ -0,0 +1,18 @@
+package d2networking
+
+import "github.com/OpenDiablo2/OpenDiablo2/d2networking/d2netpacket"
+
+// ClientListener is implemented by the game client so that a
+// ClientConnection can hand it received packets and report connection
+// lifecycle changes.
+type ClientListener interface {
+	// OnPacketReceived is called whenever a packet arrives from the
+	// server.
+	OnPacketReceived(packet d2netpacket.NetPacket) error
+
+	// OnConnectionStateChanged is called whenever the connection's
+	// ConnectionState changes, so the UI can react (e.g. show a
+	// "reconnecting..." overlay) instead of the connection failing
+	// silently.
+	OnConnectionStateChanged(state ConnectionState)
+}
@@ -0,0 +1,38 @@
+package d2networking
+
+// ConnectionState describes where a ClientConnection is in its
+// connect/heartbeat/reconnect lifecycle. ClientListener.OnConnectionStateChanged
+// is invoked whenever it changes.
+type ConnectionState int
+
+const (
+	// ConnectionStateConnecting is set while the initial Transport dial
+	// is in flight.
+	ConnectionStateConnecting ConnectionState = iota
+	// ConnectionStateConnected is set once the connection is dialed and
+	// exchanging packets normally.
+	ConnectionStateConnected
+	// ConnectionStateReconnecting is set once too many heartbeats have
+	// gone unanswered (or the transport errors) and a redial is being
+	// attempted with exponential backoff.
+	ConnectionStateReconnecting
+	// ConnectionStateClosed is set once Close has been called; the
+	// connection will not attempt to reconnect from this state.
+	ConnectionStateClosed
+)
+
+// String implements fmt.Stringer for use in log messages.
+func (s ConnectionState) String() string {
+	switch s {
+	case ConnectionStateConnecting:
+		return "Connecting"
+	case ConnectionStateConnected:
+		return "Connected"
+	case ConnectionStateReconnecting:
+		return "Reconnecting"
+	case ConnectionStateClosed:
+		return "Closed"
+	default:
+		return "Unknown"
+	}
+}
@@ -0,0 +1,75 @@
+package d2remoteclient
+
+import (
+	"sync"
+	"time"
+)
+
+// heartbeatInterval is how often RemoteClientConnection pings the
+// server to measure RTT and detect a dead link.
+const heartbeatInterval = 2 * time.Second
+
+// maxMissedHeartbeats is how many consecutive pings may go unanswered
+// before the link is considered dead and a reconnect is attempted.
+const maxMissedHeartbeats = 3
+
+// heartbeat tracks the outstanding ping (if any) for a connection and
+// the RTT measured from the last one that was answered.
+type heartbeat struct {
+	mu       sync.Mutex
+	sentAt   time.Time
+	awaiting bool
+	missed   int
+	rtt      time.Duration
+}
+
+// sent records that a ping was just sent and is awaiting a pong.
+func (h *heartbeat) sent() {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	h.sentAt = time.Now()
+	h.awaiting = true
+}
+
+// pong records that the outstanding ping was answered, updates RTT,
+// and resets the missed-heartbeat counter.
+func (h *heartbeat) pong() time.Duration {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if h.awaiting {
+		h.rtt = time.Since(h.sentAt)
+	}
+
+	h.awaiting = false
+	h.missed = 0
+
+	return h.rtt
+}
+
+// checkMissed is called on every heartbeat tick before sending the
+// next ping. If a ping is still awaiting a pong, it counts as missed
+// and the running total is returned; awaiting is false if there was no
+// outstanding ping (e.g. the first tick, or one that was just
+// answered).
+func (h *heartbeat) checkMissed() (missed int, awaiting bool) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if !h.awaiting {
+		return h.missed, false
+	}
+
+	h.missed++
+
+	return h.missed, true
+}
+
+// RTT returns the most recently measured round-trip time.
+func (h *heartbeat) RTT() time.Duration {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	return h.rtt
+}
@@ -2,15 +2,11 @@
 package d2remoteclient
 
 import (
-	"bytes"
-	"compress/gzip"
-	"encoding/json"
-	"errors"
 	"fmt"
-	"io"
 	"log"
-	"net"
-	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
 
 	"github.com/OpenDiablo2/OpenDiablo2/d2networking/d2client/d2clientconnectiontype"
 
@@ -18,27 +14,61 @@ import (
 
 	"github.com/OpenDiablo2/OpenDiablo2/d2networking"
 	"github.com/OpenDiablo2/OpenDiablo2/d2networking/d2netpacket"
+	"github.com/OpenDiablo2/OpenDiablo2/d2networking/d2netpacket/d2netcodec"
 	"github.com/OpenDiablo2/OpenDiablo2/d2networking/d2netpacket/d2netpackettype"
+	"github.com/OpenDiablo2/OpenDiablo2/d2networking/d2transport"
 	uuid "github.com/satori/go.uuid"
+	"github.com/vmihailenco/msgpack/v5"
 )
 
+// retransmitTickInterval is how often retransmitLoop asks the current
+// connSession's sender to resend unacknowledged frames.
+const retransmitTickInterval = 100 * time.Millisecond
+
+// initialReconnectBackoff and maxReconnectBackoff bound the
+// exponential backoff beginReconnect uses between redial attempts.
+const (
+	initialReconnectBackoff = 1 * time.Second
+	maxReconnectBackoff     = 30 * time.Second
+)
+
+// connSession bundles the transport, sender, receiver, and heartbeat
+// created together by a single dial() call. Bundling them lets
+// RemoteClientConnection publish all four atomically on reconnect (via
+// session) instead of racing individual field writes against the
+// serverListener/heartbeatLoop/retransmitLoop goroutines that read them,
+// and lets each such goroutine be bound to the specific session it was
+// started for rather than whatever dial() has most recently swapped in.
+type connSession struct {
+	transport d2networking.Transport // Connection to the server (udp://, ws://, or mem://)
+	sender    *d2netcodec.Sender     // Assigns sequence numbers and retransmits unacknowledged frames
+	receiver  *d2netcodec.Receiver   // Reassembles fragments and drops duplicate frames
+	heartbeat *heartbeat             // Tracks outstanding pings, RTT, and missed heartbeats
+}
+
 // RemoteClientConnection is the implementation of ClientConnection
 // for a remote client.
 type RemoteClientConnection struct {
-	clientListener d2networking.ClientListener // The GameClient
-	uniqueId       string                      // Unique ID generated on construction
-	udpConnection  *net.UDPConn                // UDP connection to the server
-	active         bool                        // The connection is currently open
+	clientListener   d2networking.ClientListener // The GameClient
+	uniqueId         string                      // Unique ID generated on construction
+	connectionString string                      // Address last passed to Open, reused to reconnect
+	session          atomic.Value                // Holds the current *connSession, swapped wholesale by dial()
+
+	stateMu sync.Mutex                   // Guards state
+	state   d2networking.ConnectionState // Current point in the connect/heartbeat/reconnect lifecycle
+
+	outboxMu sync.Mutex // Guards outbox
+	outbox   [][]byte   // Encoded packets sent while not Connected, flushed once reconnected
 }
 
 // GetUniqueId returns RemoteClientConnection.uniqueId.
-func (l RemoteClientConnection) GetUniqueId() string {
+func (l *RemoteClientConnection) GetUniqueId() string {
 	return l.uniqueId
 }
 
 // GetConnectionType returns an enum representing the connection type.
 // See: d2clientconnectiontype
-func (l RemoteClientConnection) GetConnectionType() d2clientconnectiontype.ClientConnectionType {
+func (l *RemoteClientConnection) GetConnectionType() d2clientconnectiontype.ClientConnectionType {
 	return d2clientconnectiontype.LANClient
 }
 
@@ -57,76 +87,287 @@ func Create() *RemoteClientConnection {
 	return result
 }
 
-// Open runs serverListener() in a goroutine to continuously read UDP packets.
-// It also sends a PlayerConnectionRequestPacket packet to the server (see d2netpacket).
+// Open dials connectionString via d2transport.Dial (which picks a
+// Transport based on its udp://, ws://, or mem:// scheme, defaulting to
+// udp:// for a bare host:port), starts serverListener and heartbeatLoop
+// in goroutines, and sends a PlayerConnectionRequestPacket packet to
+// the server (see d2netpacket). connectionString is remembered so that
+// beginReconnect can redial it if the link later goes quiet.
 func (l *RemoteClientConnection) Open(connectionString string, saveFilePath string) error {
-	if !strings.Contains(connectionString, ":") {
-		connectionString += ":6669"
-	}
-
-	// TODO: Connect to the server
-	udpAddress, err := net.ResolveUDPAddr("udp", connectionString)
+	l.connectionString = connectionString
+	l.setState(d2networking.ConnectionStateConnecting)
 
 	// TODO: Show connection error screen if connection fails
-	if err != nil {
+	if err := l.dial(connectionString); err != nil {
 		return err
 	}
 
-	l.udpConnection, err = net.DialUDP("udp", nil, udpAddress)
-	// TODO: Show connection error screen if connection fails
+	l.setState(d2networking.ConnectionStateConnected)
+	go l.retransmitLoop()
+
+	log.Printf("Connected to server at %s", connectionString)
+	gameState := d2player.LoadPlayerState(saveFilePath)
+
+	err := l.SendPacketToServer(d2netpacket.CreatePlayerConnectionRequestPacket(l.GetUniqueId(), gameState))
 	if err != nil {
+		log.Print("RemoteClientConnection: error sending PlayerConnectionRequestPacket to server.")
 		return err
 	}
 
-	l.active = true
-	go l.serverListener()
+	return nil
+}
 
-	log.Printf("Connected to server at %s", l.udpConnection.RemoteAddr().String())
-	gameState := d2player.LoadPlayerState(saveFilePath)
-	err = l.SendPacketToServer(d2netpacket.CreatePlayerConnectionRequestPacket(l.GetUniqueId(), gameState))
+// dial connects to connectionString, builds a fresh connSession around
+// it, and publishes it as the current session before starting
+// serverListener and heartbeatLoop for it. Each is handed this specific
+// session rather than reading l.session itself, so a session's
+// goroutines can never end up reading another session's transport once
+// a later reconnect has replaced it. It is used both by Open and by
+// beginReconnect.
+func (l *RemoteClientConnection) dial(connectionString string) error {
+	transport, err := d2transport.Dial(connectionString)
 	if err != nil {
-		log.Print("RemoteClientConnection: error sending PlayerConnectionRequestPacket to server.")
 		return err
 	}
 
+	session := &connSession{transport: transport}
+	session.sender = d2netcodec.NewSender(transport.Send)
+	session.receiver = d2netcodec.NewReceiver(func(seq uint32) error {
+		return transport.Send(d2netcodec.AckFrame(seq))
+	})
+	session.heartbeat = &heartbeat{}
+
+	l.session.Store(session)
+
+	go l.serverListener(session)
+	go l.heartbeatLoop(session)
+
 	return nil
 }
 
-// Close informs the server that this client has disconnected and sets
-// RemoteClientConnection.active to false.
+// currentSession returns the connSession most recently published by
+// dial, or nil if Open has never successfully dialed.
+func (l *RemoteClientConnection) currentSession() *connSession {
+	session, _ := l.session.Load().(*connSession)
+	return session
+}
+
+// RTT returns the round-trip time measured from the most recently
+// answered heartbeat ping, or 0 if none has been answered yet.
+func (l *RemoteClientConnection) RTT() time.Duration {
+	session := l.currentSession()
+	if session == nil {
+		return 0
+	}
+
+	return session.heartbeat.RTT()
+}
+
+// Close informs the server that this client has disconnected, moves
+// RemoteClientConnection to ConnectionStateClosed (so heartbeatLoop,
+// retransmitLoop, serverListener, and any in-flight beginReconnect
+// stop), and closes the underlying transport.
 func (l *RemoteClientConnection) Close() error {
-	l.active = false
 	err := l.SendPacketToServer(d2netpacket.CreatePlayerDisconnectRequestPacket(l.GetUniqueId()))
-	if err != nil {
-		return err
+	l.setState(d2networking.ConnectionStateClosed)
+
+	if session := l.currentSession(); session != nil {
+		if closeErr := session.transport.Close(); err == nil {
+			err = closeErr
+		}
 	}
 
-	return nil
+	return err
+}
+
+// ConnectionState returns RemoteClientConnection's current point in
+// its connect/heartbeat/reconnect lifecycle.
+func (l *RemoteClientConnection) ConnectionState() d2networking.ConnectionState {
+	l.stateMu.Lock()
+	defer l.stateMu.Unlock()
+
+	return l.state
 }
 
-// SendPacketToServer compresses the JSON encoding of a NetPacket and
-// sends it to the server.
+// setState updates RemoteClientConnection.state and, if it actually
+// changed, notifies clientListener via OnConnectionStateChanged.
+func (l *RemoteClientConnection) setState(state d2networking.ConnectionState) {
+	l.stateMu.Lock()
+	changed := l.state != state
+	l.state = state
+	l.stateMu.Unlock()
+
+	if changed && l.clientListener != nil {
+		l.clientListener.OnConnectionStateChanged(state)
+	}
+}
+
+// tryBeginReconnecting atomically moves RemoteClientConnection from
+// ConnectionStateConnected to ConnectionStateReconnecting. It returns
+// false if the connection was already reconnecting or closed, so that
+// a heartbeat timeout and a concurrent transport read error don't both
+// start a reconnect loop.
+func (l *RemoteClientConnection) tryBeginReconnecting() bool {
+	l.stateMu.Lock()
+	if l.state != d2networking.ConnectionStateConnected {
+		l.stateMu.Unlock()
+		return false
+	}
+
+	l.state = d2networking.ConnectionStateReconnecting
+	l.stateMu.Unlock()
+
+	if l.clientListener != nil {
+		l.clientListener.OnConnectionStateChanged(d2networking.ConnectionStateReconnecting)
+	}
+
+	return true
+}
+
+// beginReconnect redials l.connectionString with exponential backoff
+// until it succeeds or the connection is closed, buffering any packets
+// SendPacketToServer is asked to send in the meantime. It is a no-op
+// if the connection isn't currently ConnectionStateConnected.
+//
+// Close running concurrently with an in-flight reconnect is handled
+// explicitly: once dial succeeds, the state is re-checked under stateMu
+// before being claimed as ConnectionStateConnected. If Close already
+// moved it to ConnectionStateClosed in the meantime, the transport dial
+// just opened is closed immediately instead of resurrecting a
+// connection the caller explicitly closed.
+func (l *RemoteClientConnection) beginReconnect() {
+	if !l.tryBeginReconnecting() {
+		return
+	}
+
+	backoff := initialReconnectBackoff
+
+	for l.ConnectionState() == d2networking.ConnectionStateReconnecting {
+		log.Printf("RemoteClientConnection: reconnecting to %s in %s", l.connectionString, backoff)
+		time.Sleep(backoff)
+
+		if l.ConnectionState() != d2networking.ConnectionStateReconnecting {
+			return
+		}
+
+		if err := l.dial(l.connectionString); err != nil {
+			log.Printf("RemoteClientConnection: reconnect attempt failed: %s", err)
+
+			backoff *= 2
+			if backoff > maxReconnectBackoff {
+				backoff = maxReconnectBackoff
+			}
+
+			continue
+		}
+
+		l.stateMu.Lock()
+		if l.state != d2networking.ConnectionStateReconnecting {
+			l.stateMu.Unlock()
+
+			if session := l.currentSession(); session != nil {
+				_ = session.transport.Close()
+			}
+
+			return
+		}
+		l.state = d2networking.ConnectionStateConnected
+		l.stateMu.Unlock()
+
+		if l.clientListener != nil {
+			l.clientListener.OnConnectionStateChanged(d2networking.ConnectionStateConnected)
+		}
+
+		l.flushOutbox()
+
+		return
+	}
+}
+
+// SendPacketToServer encodes packet with d2netcodec. While Connected
+// it hands the result to the current connSession's sender, which
+// fragments it if needed and tracks it for retransmission until the
+// server acknowledges it. While reconnecting, the encoded packet is
+// buffered and replayed in order by flushOutbox once the connection is
+// re-established.
 func (l *RemoteClientConnection) SendPacketToServer(packet d2netpacket.NetPacket) error {
-	data, err := json.Marshal(packet.PacketData)
+	encoded, err := d2netcodec.Encode(packet)
 	if err != nil {
 		return err
 	}
-	var buff bytes.Buffer
-	buff.WriteByte(byte(packet.PacketType))
-	writer, _ := gzip.NewWriterLevel(&buff, gzip.BestCompression)
 
-	if written, err := writer.Write(data); err != nil {
-		return err
-	} else if written == 0 {
-		return errors.New(fmt.Sprintf("RemoteClientConnection: attempted to send empty %v packet body.", packet.PacketType))
+	if l.ConnectionState() != d2networking.ConnectionStateConnected {
+		l.outboxMu.Lock()
+		l.outbox = append(l.outbox, encoded)
+		l.outboxMu.Unlock()
+
+		return nil
 	}
-	if err = writer.Close(); err != nil {
-		return err
+
+	return l.currentSession().sender.Send(encoded)
+}
+
+// flushOutbox sends every packet buffered by SendPacketToServer while
+// disconnected, in the order they were originally sent.
+func (l *RemoteClientConnection) flushOutbox() {
+	l.outboxMu.Lock()
+	pending := l.outbox
+	l.outbox = nil
+	l.outboxMu.Unlock()
+
+	sender := l.currentSession().sender
+
+	for _, encoded := range pending {
+		if err := sender.Send(encoded); err != nil {
+			log.Printf("RemoteClientConnection: error flushing buffered packet: %s", err)
+		}
 	}
-	if _, err = l.udpConnection.Write(buff.Bytes()); err != nil {
-		return err
+}
+
+// retransmitLoop periodically resends any frame the current
+// connSession's sender has not yet seen acknowledged.
+func (l *RemoteClientConnection) retransmitLoop() {
+	ticker := time.NewTicker(retransmitTickInterval)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		if l.ConnectionState() == d2networking.ConnectionStateClosed {
+			return
+		}
+
+		if session := l.currentSession(); session != nil {
+			session.sender.Retransmit()
+		}
+	}
+}
+
+// heartbeatLoop periodically pings the server to measure RTT. If
+// maxMissedHeartbeats consecutive pings go unanswered, it starts
+// beginReconnect and stops. It is bound to the connSession dial()
+// started it for, and stops as soon as that session is no longer the
+// current one (Close, or a reconnect that replaced it with a new
+// session), rather than pinging through a transport it no longer owns.
+func (l *RemoteClientConnection) heartbeatLoop(session *connSession) {
+	ticker := time.NewTicker(heartbeatInterval)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		if l.ConnectionState() != d2networking.ConnectionStateConnected || l.currentSession() != session {
+			return
+		}
+
+		if missed, awaiting := session.heartbeat.checkMissed(); awaiting && missed >= maxMissedHeartbeats {
+			log.Printf("RemoteClientConnection: %d consecutive heartbeats missed, reconnecting", missed)
+			go l.beginReconnect()
+
+			return
+		}
+
+		session.heartbeat.sent()
+		if err := l.SendPacketToServer(d2netpacket.CreatePingPacket(l.uniqueId)); err != nil {
+			log.Printf("RemoteClientConnection: error sending heartbeat ping: %s", err)
+		}
 	}
-	return nil
 }
 
 // SetClientListener sets RemoteClientConnection.clientListener to the given value.
@@ -134,109 +375,84 @@ func (l *RemoteClientConnection) SetClientListener(listener d2networking.ClientL
 	l.clientListener = listener
 }
 
-// serverListener runs a while loop, reading from the GameServer's UDP
-// connection.
-func (l *RemoteClientConnection) serverListener() {
-	buffer := make([]byte, 4096)
-	for l.active {
-		n, _, err := l.udpConnection.ReadFromUDP(buffer)
+// serverListener runs a while loop, reading frames from session's
+// transport into session.receiver's reassembly buffer. A frame is only
+// handed off to the switch below once every fragment of its sequence
+// has arrived, so packets larger than a single transport frame (e.g.
+// GenerateMapPacket) are no longer truncated. Like heartbeatLoop, it is
+// bound to the connSession dial() started it for and stops as soon as
+// that session is no longer current.
+func (l *RemoteClientConnection) serverListener(session *connSession) {
+	for l.ConnectionState() != d2networking.ConnectionStateClosed && l.currentSession() == session {
+		raw, err := session.transport.Recv()
 		if err != nil {
-			fmt.Printf("Socket error: %s\n", err)
-			continue
+			fmt.Printf("Transport error: %s\n", err)
+			go l.beginReconnect()
+
+			return
 		}
-		if n <= 0 {
+		if len(raw) == 0 {
 			continue
 		}
-		buff := bytes.NewBuffer(buffer)
-		packetTypeId, err := buff.ReadByte()
-		packetType := d2netpackettype.NetPacketType(packetTypeId)
-		reader, err := gzip.NewReader(buff)
-		sb := new(strings.Builder)
-		written, err := io.Copy(sb, reader)
+
+		encoded, ok, err := session.receiver.Accept(raw)
 		if err != nil {
-			log.Printf("RemoteClientConnection: error copying bytes from %v packet: %s", packetType, err)
-			// TODO: All packets coming from the client seem to be throwing an error
-			//continue
+			log.Printf("RemoteClientConnection: error reassembling frame: %s", err)
+			continue
 		}
-		if written == 0 {
-			log.Printf("RemoteClientConnection: empty packet %v packet received", packetType)
+		if !ok {
 			continue
 		}
 
-		stringData := sb.String()
+		decoded, err := d2netcodec.Decode(encoded)
+		if err != nil {
+			log.Printf("RemoteClientConnection: error decoding frame: %s", err)
+			continue
+		}
+
+		packetType := decoded.PacketType
+
+		// Ping, Pong, and PlayerDisconnectionNotification get
+		// connection-specific handling rather than the generic registry
+		// dispatch below: Ping needs a pong reply, Pong feeds the
+		// heartbeat RTT/missed-heartbeat tracking, and a disconnect
+		// notification is logged instead of forwarded to the client.
 		switch packetType {
-		case d2netpackettype.GenerateMap:
-			var packet d2netpacket.GenerateMapPacket
-			err := json.Unmarshal([]byte(stringData), &packet)
-			if err != nil {
-				log.Printf("GameServer: error unmarshalling %T: %s", packet, err)
-				continue
-			}
-			err = l.SendPacketToClient(d2netpacket.NetPacket{
-				PacketType: packetType,
-				PacketData: packet,
-			})
-			if err != nil {
-				log.Printf("RemoteClientConnection: error processing packet %v: %s", packetType, err)
-			}
-		case d2netpackettype.MovePlayer:
-			var packet d2netpacket.MovePlayerPacket
-			err := json.Unmarshal([]byte(stringData), &packet)
-			if err != nil {
-				log.Printf("GameServer: error unmarshalling %T: %s", packet, err)
-				continue
-			}
-			err = l.SendPacketToClient(d2netpacket.NetPacket{
-				PacketType: packetType,
-				PacketData: packet,
-			})
-			if err != nil {
-				log.Printf("RemoteClientConnection: error processing packet %v: %s", packetType, err)
-			}
-		case d2netpackettype.UpdateServerInfo:
-			var packet d2netpacket.UpdateServerInfoPacket
-			err := json.Unmarshal([]byte(stringData), &packet)
-			if err != nil {
-				log.Printf("GameServer: error unmarshalling %T: %s", packet, err)
-				continue
-			}
-			err = l.SendPacketToClient(d2netpacket.NetPacket{
-				PacketType: packetType,
-				PacketData: packet,
-			})
-			if err != nil {
-				log.Printf("RemoteClientConnection: error processing packet %v: %s", packetType, err)
-			}
-		case d2netpackettype.AddPlayer:
-			var packet d2netpacket.AddPlayerPacket
-			err := json.Unmarshal([]byte(stringData), &packet)
-			if err != nil {
-				log.Printf("GameServer: error unmarshalling %T: %s", packet, err)
-				continue
-			}
-			err = l.SendPacketToClient(d2netpacket.NetPacket{
-				PacketType: packetType,
-				PacketData: packet,
-			})
-			if err != nil {
-				log.Printf("RemoteClientConnection: error processing packet %v: %s", packetType, err)
-			}
 		case d2netpackettype.Ping:
-			err := l.SendPacketToServer(d2netpacket.CreatePongPacket(l.uniqueId))
-			if err != nil {
+			if err := l.SendPacketToServer(d2netpacket.CreatePongPacket(l.uniqueId)); err != nil {
 				log.Printf("RemoteClientConnection: error responding to server ping: %s", err)
 			}
+
+			continue
+		case d2netpackettype.Pong:
+			rtt := session.heartbeat.pong()
+			log.Printf("RemoteClientConnection: heartbeat rtt %s", rtt)
+
+			continue
 		case d2netpackettype.PlayerDisconnectionNotification:
 			var packet d2netpacket.PlayerDisconnectRequestPacket
-			err := json.Unmarshal([]byte(stringData), &packet)
-			if err != nil {
+			if err := msgpack.Unmarshal(decoded.Payload, &packet); err != nil {
 				log.Printf("GameServer: error unmarshalling %T: %s", packet, err)
 				continue
 			}
+
 			log.Printf("Received disconnect: %s", packet.Id)
-		default:
-			fmt.Printf("Unknown packet type %d\n", packetType)
+
+			continue
+		}
+
+		packetData, err := d2netpacket.Registry.Unmarshal(packetType, decoded.Payload)
+		if err != nil {
+			log.Printf("GameServer: error decoding packet %v: %s", packetType, err)
+			continue
 		}
 
+		err = l.SendPacketToClient(d2netpacket.NetPacket{
+			PacketType: packetType,
+			PacketData: packetData,
+		})
+		if err != nil {
+			log.Printf("RemoteClientConnection: error processing packet %v: %s", packetType, err)
+		}
 	}
 }
@@ -0,0 +1,127 @@
+package d2remoteclient
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/OpenDiablo2/OpenDiablo2/d2networking"
+	"github.com/OpenDiablo2/OpenDiablo2/d2networking/d2netpacket"
+	"github.com/OpenDiablo2/OpenDiablo2/d2networking/d2transport"
+)
+
+// stateRecorder is a minimal d2networking.ClientListener that records
+// every ConnectionState RemoteClientConnection reports, in order.
+type stateRecorder struct {
+	mu     sync.Mutex
+	states []d2networking.ConnectionState
+}
+
+func (r *stateRecorder) OnPacketReceived(d2netpacket.NetPacket) error { return nil }
+
+func (r *stateRecorder) OnConnectionStateChanged(state d2networking.ConnectionState) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.states = append(r.states, state)
+}
+
+// waitUntil polls cond every millisecond until it returns true, failing
+// t if timeout passes first.
+func waitUntil(t *testing.T, timeout time.Duration, cond func() bool) {
+	t.Helper()
+
+	deadline := time.Now().Add(timeout)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatalf("condition not met within %s", timeout)
+		}
+
+		time.Sleep(time.Millisecond)
+	}
+}
+
+// TestCloseDuringReconnectDoesNotResurrectConnection reproduces the
+// session-swap/Close race fixed alongside the connSession rework: Close
+// is called while beginReconnect's redial is blocked mid-dial (the
+// mem:// listener on the other end deliberately isn't accepting yet),
+// then the dial is allowed to complete. beginReconnect must not be able
+// to move the connection back to ConnectionStateConnected once Close
+// has already moved it to ConnectionStateClosed.
+func TestCloseDuringReconnectDoesNotResurrectConnection(t *testing.T) {
+	name := "reconnect-race-test"
+
+	// ListenMemory blocks until Open's Dial call reaches the matching
+	// DialMemory, so it must run concurrently with Open rather than
+	// before it.
+	listen1 := make(chan *d2transport.MemoryTransport, 1)
+	go func() {
+		server, err := d2transport.ListenMemory(name)
+		if err != nil {
+			t.Errorf("ListenMemory returned error: %s", err)
+			return
+		}
+
+		listen1 <- server
+	}()
+
+	listener := &stateRecorder{}
+	conn := Create()
+	conn.SetClientListener(listener)
+
+	if err := conn.Open("mem://"+name, ""); err != nil {
+		t.Fatalf("Open returned error: %s", err)
+	}
+
+	select {
+	case <-listen1:
+	case <-time.After(time.Second):
+		t.Fatal("ListenMemory never paired with Open's dial")
+	}
+
+	waitUntil(t, time.Second, func() bool {
+		return conn.ConnectionState() == d2networking.ConnectionStateConnected
+	})
+
+	// Break the client's own end of the transport so serverListener sees
+	// a Recv error and starts beginReconnect. Closing the server end
+	// wouldn't do this: each MemoryTransport half has its own closed
+	// channel, so only a local transport error (as a real socket error
+	// would also do) unblocks Recv on this side.
+	if err := conn.currentSession().transport.Close(); err != nil {
+		t.Fatalf("transport.Close returned error: %s", err)
+	}
+
+	waitUntil(t, time.Second, func() bool {
+		return conn.ConnectionState() == d2networking.ConnectionStateReconnecting
+	})
+
+	// Wait out beginReconnect's backoff sleep and its pre-dial state
+	// recheck, so it is now blocked inside dial's DialMemory call,
+	// waiting for a matching ListenMemory(name) that nothing is offering
+	// yet. Close while it's stuck there, exactly the window the race fix
+	// targets.
+	time.Sleep(initialReconnectBackoff + 200*time.Millisecond)
+
+	if err := conn.Close(); err != nil {
+		t.Fatalf("Close returned error: %s", err)
+	}
+
+	if state := conn.ConnectionState(); state != d2networking.ConnectionStateClosed {
+		t.Fatalf("state after Close = %v, want Closed", state)
+	}
+
+	// Now let the blocked redial finish.
+	server2, err := d2transport.ListenMemory(name)
+	if err != nil {
+		t.Fatalf("ListenMemory returned error: %s", err)
+	}
+	defer server2.Close()
+
+	// Give beginReconnect's post-dial check time to run.
+	time.Sleep(50 * time.Millisecond)
+
+	if state := conn.ConnectionState(); state != d2networking.ConnectionStateClosed {
+		t.Fatalf("state after the redial completed = %v, want Closed (connection must not resurrect)", state)
+	}
+}
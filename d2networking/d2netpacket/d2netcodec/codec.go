@@ -0,0 +1,94 @@
+// Package d2netcodec implements the wire encoding used to move
+// d2netpacket.NetPacket values between the client and the server.
+//
+// Packets are framed as a varint payload length, a single packet-type
+// byte, and the MessagePack-encoded packet body. This replaces the
+// previous JSON+gzip-over-a-single-UDP-datagram scheme, which silently
+// truncated any packet larger than the fixed 4096-byte read buffer and
+// spent CPU both marshaling to JSON's text representation and then
+// gzipping it back down. MessagePack gives the compact binary payload
+// that prompted the change without hand-rolling a per-packet encoder
+// for every current and future NetPacketType. Encoded packets that do
+// not fit in a single UDP datagram are then split into fragments by the
+// reliability layer in reliability.go.
+package d2netcodec
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+
+	"github.com/OpenDiablo2/OpenDiablo2/d2networking/d2netpacket"
+	"github.com/OpenDiablo2/OpenDiablo2/d2networking/d2netpacket/d2netpackettype"
+	"github.com/vmihailenco/msgpack/v5"
+)
+
+// maxVarintLen is the maximum number of bytes binary.PutUvarint can
+// produce for a uint64 length prefix.
+const maxVarintLen = binary.MaxVarintLen64
+
+// Encode serializes packet as a varint length prefix, a packet-type
+// byte, and the MessagePack-encoded PacketData. The length prefix
+// covers everything that follows it (the type byte and the payload),
+// so a reader only needs to know where the frame starts.
+func Encode(packet d2netpacket.NetPacket) ([]byte, error) {
+	payload, err := msgpack.Marshal(packet.PacketData)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(payload) == 0 {
+		return nil, fmt.Errorf("d2netcodec: attempted to encode empty %v packet body", packet.PacketType)
+	}
+
+	body := make([]byte, 1+len(payload))
+	body[0] = byte(packet.PacketType)
+	copy(body[1:], payload)
+
+	lengthPrefix := make([]byte, maxVarintLen)
+	n := binary.PutUvarint(lengthPrefix, uint64(len(body)))
+
+	buff := bytes.NewBuffer(make([]byte, 0, n+len(body)))
+	buff.Write(lengthPrefix[:n])
+	buff.Write(body)
+
+	return buff.Bytes(), nil
+}
+
+// DecodedFrame is the result of pulling one frame out of a byte
+// stream: the packet type and the still-MessagePack-encoded payload,
+// plus how many bytes of the input the frame occupied.
+type DecodedFrame struct {
+	PacketType d2netpackettype.NetPacketType
+	Payload    []byte
+	Consumed   int
+}
+
+// Decode reads a single varint-length-prefixed frame from data. It
+// does not know how to unmarshal every packet type itself; callers use
+// DecodedFrame.PacketType to pick the concrete struct to unmarshal
+// DecodedFrame.Payload into (see d2netpacket.Registry for a dispatcher
+// that does this generically).
+func Decode(data []byte) (DecodedFrame, error) {
+	length, n := binary.Uvarint(data)
+	if n <= 0 {
+		return DecodedFrame{}, fmt.Errorf("d2netcodec: malformed length prefix")
+	}
+
+	end := n + int(length)
+	if end > len(data) {
+		return DecodedFrame{}, fmt.Errorf("d2netcodec: truncated frame, want %d bytes, have %d", end, len(data))
+	}
+
+	if length < 1 {
+		return DecodedFrame{}, fmt.Errorf("d2netcodec: empty frame body")
+	}
+
+	body := data[n:end]
+
+	return DecodedFrame{
+		PacketType: d2netpackettype.NetPacketType(body[0]),
+		Payload:    body[1:],
+		Consumed:   end,
+	}, nil
+}
@@ -0,0 +1,57 @@
+package d2netcodec
+
+import (
+	"encoding/binary"
+	"fmt"
+)
+
+// frameFlag marks what a Frame carries.
+type frameFlag byte
+
+const (
+	flagData frameFlag = 1 << iota // Body holds (a fragment of) an encoded packet
+	flagAck                        // the frame is an acknowledgement for Sequence, Body is empty
+)
+
+// frameHeaderSize is the size, in bytes, of a marshaled Frame's fixed
+// header: Sequence (4) + FragIndex (2) + FragCount (2) + Flags (1).
+const frameHeaderSize = 4 + 2 + 2 + 1
+
+// Frame is the unit the reliability layer sends over a Transport. Each
+// Frame either acknowledges a previously received Sequence, or carries
+// one fragment of an Encode'd packet; FragCount is 1 for packets that
+// fit in a single datagram.
+type Frame struct {
+	Sequence  uint32
+	FragIndex uint16
+	FragCount uint16
+	Flags     frameFlag
+	Body      []byte
+}
+
+// Marshal serializes f to bytes suitable for handing to a Transport.
+func (f Frame) Marshal() []byte {
+	out := make([]byte, frameHeaderSize+len(f.Body))
+	binary.BigEndian.PutUint32(out[0:4], f.Sequence)
+	binary.BigEndian.PutUint16(out[4:6], f.FragIndex)
+	binary.BigEndian.PutUint16(out[6:8], f.FragCount)
+	out[8] = byte(f.Flags)
+	copy(out[frameHeaderSize:], f.Body)
+
+	return out
+}
+
+// UnmarshalFrame parses a Frame previously produced by Frame.Marshal.
+func UnmarshalFrame(data []byte) (Frame, error) {
+	if len(data) < frameHeaderSize {
+		return Frame{}, fmt.Errorf("d2netcodec: frame too short, got %d bytes", len(data))
+	}
+
+	return Frame{
+		Sequence:  binary.BigEndian.Uint32(data[0:4]),
+		FragIndex: binary.BigEndian.Uint16(data[4:6]),
+		FragCount: binary.BigEndian.Uint16(data[6:8]),
+		Flags:     frameFlag(data[8]),
+		Body:      data[frameHeaderSize:],
+	}, nil
+}
@@ -0,0 +1,91 @@
+package d2netcodec
+
+import "time"
+
+// incompleteSequenceTimeout bounds how long Reassembler waits for the
+// rest of a sequence's fragments before evicting it. Without this, a
+// sequence whose Sender has moved on (the connection reconnected and
+// replaced it, see RemoteClientConnection.dial) would never complete
+// and its fragments/counts/received entries would stay in these maps
+// for the life of the Reassembler.
+const incompleteSequenceTimeout = 10 * time.Second
+
+// Reassembler buffers the fragments of logical frames, keyed by
+// sequence number, until every fragment for a sequence has arrived and
+// the original encoded packet can be reconstructed.
+type Reassembler struct {
+	fragments map[uint32][][]byte
+	counts    map[uint32]uint16
+	received  map[uint32]uint16
+	firstSeen map[uint32]time.Time
+}
+
+// NewReassembler constructs an empty Reassembler.
+func NewReassembler() *Reassembler {
+	return &Reassembler{
+		fragments: make(map[uint32][][]byte),
+		counts:    make(map[uint32]uint16),
+		received:  make(map[uint32]uint16),
+		firstSeen: make(map[uint32]time.Time),
+	}
+}
+
+// Add records one fragment of a sequence's fragCount total fragments.
+// It returns the concatenation of every fragment, in order, and true
+// once all fragCount fragments for seq have been seen.
+func (r *Reassembler) Add(seq uint32, fragIndex, fragCount uint16, body []byte) ([]byte, bool) {
+	r.evictStale()
+
+	if fragCount == 0 {
+		fragCount = 1
+	}
+
+	slots, ok := r.fragments[seq]
+	if !ok {
+		slots = make([][]byte, fragCount)
+		r.fragments[seq] = slots
+		r.counts[seq] = fragCount
+		r.firstSeen[seq] = time.Now()
+	}
+
+	if int(fragIndex) >= len(slots) {
+		return nil, false
+	}
+
+	if slots[fragIndex] == nil {
+		r.received[seq]++
+	}
+
+	slots[fragIndex] = body
+
+	if r.received[seq] < r.counts[seq] {
+		return nil, false
+	}
+
+	reassembled := make([]byte, 0, len(slots))
+	for _, fragment := range slots {
+		reassembled = append(reassembled, fragment...)
+	}
+
+	delete(r.fragments, seq)
+	delete(r.counts, seq)
+	delete(r.received, seq)
+	delete(r.firstSeen, seq)
+
+	return reassembled, true
+}
+
+// evictStale drops any sequence whose first fragment arrived more than
+// incompleteSequenceTimeout ago and still hasn't completed.
+func (r *Reassembler) evictStale() {
+	cutoff := time.Now().Add(-incompleteSequenceTimeout)
+
+	for seq, seenAt := range r.firstSeen {
+		if seenAt.Before(cutoff) {
+			delete(r.fragments, seq)
+			delete(r.counts, seq)
+			delete(r.received, seq)
+			delete(r.firstSeen, seq)
+		}
+	}
+}
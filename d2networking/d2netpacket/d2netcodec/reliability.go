@@ -0,0 +1,251 @@
+package d2netcodec
+
+import (
+	"log"
+	"sync"
+	"time"
+)
+
+// maxFragmentBody is the largest Frame.Body the Sender will produce
+// before splitting an encoded packet into multiple fragments. It is
+// comfortably under the ~1472-byte practical UDP MTU payload once
+// IP/UDP headers and frameHeaderSize are accounted for.
+const maxFragmentBody = 1200
+
+// retransmitInterval is how long Sender waits for an ack before
+// resending a frame.
+const retransmitInterval = 200 * time.Millisecond
+
+// retransmitWarnThreshold is how many retries a frame gets before
+// Retransmit starts logging that it is still unacknowledged. Sender
+// never gives up on a frame itself (a fixed attempt count inside the
+// heartbeat link-dead detection window would drop packets on ordinary
+// blips the connection goes on to recover from); the connection layer
+// is what eventually decides the link is dead and reconnects, at which
+// point the whole Sender is discarded along with any frames it never
+// got acked. This threshold just makes a frame stuck for unusually long
+// visible instead of silent.
+const retransmitWarnThreshold = 20
+
+type pendingFrame struct {
+	frame   Frame
+	sentAt  time.Time
+	retries int
+	warned  bool
+}
+
+// fragKey identifies a single fragment within Sender.pending. A
+// sequence number alone is not enough: a multi-fragment packet has one
+// Frame per fragment, each needing its own retransmit tracking, so the
+// key must include FragIndex too.
+type fragKey struct {
+	seq       uint32
+	fragIndex uint16
+}
+
+// Sender assigns sequence numbers to outgoing packets, fragments them
+// if needed, and keeps resending any frame that goes unacknowledged.
+// It gives UDP a sequenced, ACK'd delivery guarantee without the
+// head-of-line blocking a single TCP stream would introduce across
+// unrelated packets.
+type Sender struct {
+	mu      sync.Mutex
+	nextSeq uint32
+	pending map[fragKey]*pendingFrame
+	send    func([]byte) error
+}
+
+// NewSender constructs a Sender that writes marshaled frames through
+// send.
+func NewSender(send func([]byte) error) *Sender {
+	return &Sender{
+		pending: make(map[fragKey]*pendingFrame),
+		send:    send,
+	}
+}
+
+// Send fragments encoded (the output of Encode) as needed, writes each
+// fragment through Sender's send func, and records each one
+// individually for retransmission until Ack is called with its shared
+// sequence number.
+func (s *Sender) Send(encoded []byte) error {
+	s.mu.Lock()
+	seq := s.nextSeq
+	s.nextSeq++
+	s.mu.Unlock()
+
+	fragCount := (len(encoded) + maxFragmentBody - 1) / maxFragmentBody
+	if fragCount == 0 {
+		fragCount = 1
+	}
+
+	for fragIndex := 0; fragIndex < fragCount; fragIndex++ {
+		start := fragIndex * maxFragmentBody
+		end := start + maxFragmentBody
+		if end > len(encoded) {
+			end = len(encoded)
+		}
+
+		frame := Frame{
+			Sequence:  seq,
+			FragIndex: uint16(fragIndex),
+			FragCount: uint16(fragCount),
+			Flags:     flagData,
+			Body:      encoded[start:end],
+		}
+
+		if err := s.send(frame.Marshal()); err != nil {
+			return err
+		}
+
+		key := fragKey{seq: seq, fragIndex: uint16(fragIndex)}
+
+		s.mu.Lock()
+		s.pending[key] = &pendingFrame{frame: frame, sentAt: time.Now()}
+		s.mu.Unlock()
+	}
+
+	return nil
+}
+
+// Ack marks every fragment of sequence seq as delivered so none of
+// them are retransmitted.
+func (s *Sender) Ack(seq uint32) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for key := range s.pending {
+		if key.seq == seq {
+			delete(s.pending, key)
+		}
+	}
+}
+
+// Retransmit resends any frame that has been waiting longer than
+// retransmitInterval for an ack. It never gives up on a frame: the
+// connection layer (see d2client/d2remoteclient's heartbeatLoop) is
+// what decides a link is dead and reconnects, discarding this Sender
+// and everything still pending on it. Until that happens, Retransmit
+// keeps trying so an ordinary outage shorter than the heartbeat
+// detection window doesn't cost any packets. It is intended to be
+// called periodically from the owning connection's event loop (e.g.
+// alongside heartbeats).
+func (s *Sender) Retransmit() {
+	s.mu.Lock()
+	due := make([]*pendingFrame, 0)
+
+	for _, p := range s.pending {
+		if time.Since(p.sentAt) < retransmitInterval {
+			continue
+		}
+
+		due = append(due, p)
+	}
+	s.mu.Unlock()
+
+	for _, p := range due {
+		if err := s.send(p.frame.Marshal()); err != nil {
+			continue
+		}
+
+		s.mu.Lock()
+		p.retries++
+
+		if p.retries >= retransmitWarnThreshold && !p.warned {
+			p.warned = true
+			log.Printf("d2netcodec: sequence %d fragment %d has been retried %d times without an ack",
+				p.frame.Sequence, p.frame.FragIndex, p.retries)
+		}
+
+		p.sentAt = time.Now()
+		s.mu.Unlock()
+	}
+}
+
+// deliveredRetention is how long Receiver remembers a fully-reassembled
+// sequence number after delivering it. It only needs to outlast the
+// round trip it takes Sender to learn about the ack and stop
+// retransmitting, after which any further frames for that sequence
+// cannot arrive; keeping delivered entries around longer than that would
+// just grow the map for the rest of the connection's life.
+const deliveredRetention = 5 * time.Second
+
+// Receiver reassembles fragmented frames and drops duplicates
+// (retransmitted frames whose sequence has already been delivered).
+type Receiver struct {
+	mu          sync.Mutex
+	reassembler *Reassembler
+	delivered   map[uint32]time.Time
+	ack         func(seq uint32) error
+}
+
+// NewReceiver constructs a Receiver that writes an ack frame through
+// ack every time it finishes reassembling a sequence.
+func NewReceiver(ack func(seq uint32) error) *Receiver {
+	return &Receiver{
+		reassembler: NewReassembler(),
+		delivered:   make(map[uint32]time.Time),
+		ack:         ack,
+	}
+}
+
+// Accept processes one raw datagram containing a single marshaled
+// Frame. It returns the reassembled encoded packet (ready for Decode)
+// and true once every fragment of a not-previously-delivered sequence
+// has arrived; it returns ok=false for ack frames, partial fragments,
+// and duplicates of an already-delivered sequence.
+func (r *Receiver) Accept(raw []byte) (encoded []byte, ok bool, err error) {
+	frame, err := UnmarshalFrame(raw)
+	if err != nil {
+		return nil, false, err
+	}
+
+	if frame.Flags&flagAck != 0 {
+		return nil, false, nil
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.evictDelivered()
+
+	if _, seen := r.delivered[frame.Sequence]; seen {
+		if r.ack != nil {
+			_ = r.ack(frame.Sequence)
+		}
+
+		return nil, false, nil
+	}
+
+	encoded, complete := r.reassembler.Add(frame.Sequence, frame.FragIndex, frame.FragCount, frame.Body)
+	if !complete {
+		return nil, false, nil
+	}
+
+	r.delivered[frame.Sequence] = time.Now()
+	if r.ack != nil {
+		if err := r.ack(frame.Sequence); err != nil {
+			return encoded, true, err
+		}
+	}
+
+	return encoded, true, nil
+}
+
+// evictDelivered drops delivered entries older than deliveredRetention.
+// Callers must hold r.mu.
+func (r *Receiver) evictDelivered() {
+	cutoff := time.Now().Add(-deliveredRetention)
+
+	for seq, deliveredAt := range r.delivered {
+		if deliveredAt.Before(cutoff) {
+			delete(r.delivered, seq)
+		}
+	}
+}
+
+// AckFrame builds the marshaled frame Receiver.ack should send back to
+// the peer to acknowledge sequence seq.
+func AckFrame(seq uint32) []byte {
+	return Frame{Sequence: seq, FragCount: 1, Flags: flagAck}.Marshal()
+}
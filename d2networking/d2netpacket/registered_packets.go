@@ -0,0 +1,22 @@
+package d2netpacket
+
+import "github.com/OpenDiablo2/OpenDiablo2/d2networking/d2netpacket/d2netpackettype"
+
+// init registers the PacketFactory for every packet type whose
+// PacketData is just forwarded to the other side verbatim (the
+// GenerateMap/MovePlayer/UpdateServerInfo/AddPlayer family). Adding a
+// new packet of this shape (chat, trade, inventory sync, party
+// updates, ...) only requires adding a line here; it does not require
+// touching RemoteClientConnection or the server listener.
+//
+// Ping and PlayerDisconnectionNotification are intentionally not
+// registered here: both require connection-specific behavior (replying
+// with a pong, logging instead of forwarding) rather than a generic
+// unmarshal-and-forward, so they stay hand-written where that
+// connection-specific code lives.
+func init() {
+	Registry.Register(d2netpackettype.GenerateMap, func() interface{} { return &GenerateMapPacket{} })
+	Registry.Register(d2netpackettype.MovePlayer, func() interface{} { return &MovePlayerPacket{} })
+	Registry.Register(d2netpackettype.UpdateServerInfo, func() interface{} { return &UpdateServerInfoPacket{} })
+	Registry.Register(d2netpackettype.AddPlayer, func() interface{} { return &AddPlayerPacket{} })
+}
@@ -0,0 +1,83 @@
+package d2netpacket
+
+import (
+	"fmt"
+	"reflect"
+
+	"github.com/OpenDiablo2/OpenDiablo2/d2networking/d2netpacket/d2netpackettype"
+	"github.com/vmihailenco/msgpack/v5"
+)
+
+// PacketFactory constructs a new, zero-valued instance of a packet's
+// PacketData so it can be passed to msgpack.Unmarshal.
+type PacketFactory func() interface{}
+
+// PacketRegistry maps packet types to the PacketFactory that builds
+// their PacketData, so the client and server can turn a decoded
+// d2netcodec frame back into a concrete packet without a hand-written
+// switch statement for every packet type. Adding a new packet type
+// (chat, trade, inventory sync, party updates, ...) is then a one-file
+// change: register it here and it is automatically handled everywhere
+// this registry is used.
+type PacketRegistry struct {
+	factories map[d2netpackettype.NetPacketType]PacketFactory
+}
+
+// Registry is the process-wide PacketRegistry used by the client and
+// server. Packet types are registered with it via Register in the init
+// func in registered_packets.go.
+var Registry = NewPacketRegistry()
+
+// NewPacketRegistry constructs an empty PacketRegistry.
+func NewPacketRegistry() *PacketRegistry {
+	return &PacketRegistry{factories: make(map[d2netpackettype.NetPacketType]PacketFactory)}
+}
+
+// Register associates packetType with factory. It panics if packetType
+// is already registered, since that indicates two packets are fighting
+// over the same type byte.
+func (r *PacketRegistry) Register(packetType d2netpackettype.NetPacketType, factory PacketFactory) {
+	if _, exists := r.factories[packetType]; exists {
+		panic(fmt.Sprintf("d2netpacket: packet type %v is already registered", packetType))
+	}
+
+	r.factories[packetType] = factory
+}
+
+// Lookup returns the PacketFactory registered for packetType, if any.
+func (r *PacketRegistry) Lookup(packetType d2netpackettype.NetPacketType) (PacketFactory, bool) {
+	factory, ok := r.factories[packetType]
+	return factory, ok
+}
+
+// New builds a new, zero-valued PacketData instance for packetType.
+// The result is a pointer (factory built it that way so it can be
+// passed to msgpack.Unmarshal); most callers want Unmarshal instead.
+func (r *PacketRegistry) New(packetType d2netpackettype.NetPacketType) (interface{}, error) {
+	factory, ok := r.Lookup(packetType)
+	if !ok {
+		return nil, fmt.Errorf("d2netpacket: no packet registered for type %v", packetType)
+	}
+
+	return factory(), nil
+}
+
+// Unmarshal builds a new PacketData instance for packetType, populates
+// it from payload, and returns the dereferenced value rather than the
+// pointer New/PacketFactory use internally to unmarshal into. This
+// keeps the concrete type NetPacket.PacketData carries for a
+// registry-dispatched packet consistent with every hand-written
+// NetPacket, which all use value types (e.g.
+// PlayerDisconnectRequestPacket, not *PlayerDisconnectRequestPacket).
+func (r *PacketRegistry) Unmarshal(packetType d2netpackettype.NetPacketType, payload []byte) (interface{}, error) {
+	packetData, err := r.New(packetType)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := msgpack.Unmarshal(payload, packetData); err != nil {
+		return nil, fmt.Errorf("d2netpacket: error unmarshalling %T: %w", packetData, err)
+	}
+
+	return reflect.ValueOf(packetData).Elem().Interface(), nil
+}
@@ -0,0 +1,34 @@
+package d2netpacket
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/OpenDiablo2/OpenDiablo2/d2networking/d2netpacket/d2netpackettype"
+	"github.com/vmihailenco/msgpack/v5"
+)
+
+// TestUnmarshalReturnsValueNotPointer guards the type-representation
+// bug Unmarshal was added to fix: New's factories hand back a pointer
+// (so msgpack.Unmarshal has something to populate), but every
+// hand-written NetPacket.PacketData in this package is a value, not a
+// pointer. Unmarshal must dereference before returning.
+func TestUnmarshalReturnsValueNotPointer(t *testing.T) {
+	payload, err := msgpack.Marshal(GenerateMapPacket{})
+	if err != nil {
+		t.Fatalf("msgpack.Marshal returned error: %s", err)
+	}
+
+	result, err := Registry.Unmarshal(d2netpackettype.GenerateMap, payload)
+	if err != nil {
+		t.Fatalf("Unmarshal returned error: %s", err)
+	}
+
+	if reflect.TypeOf(result).Kind() == reflect.Ptr {
+		t.Fatalf("Unmarshal returned %T, a pointer; want a value to match every hand-written NetPacket.PacketData", result)
+	}
+
+	if _, ok := result.(GenerateMapPacket); !ok {
+		t.Fatalf("Unmarshal returned %T, want GenerateMapPacket", result)
+	}
+}
@@ -0,0 +1,104 @@
+package d2transport
+
+import (
+	"errors"
+	"sync"
+
+	"github.com/OpenDiablo2/OpenDiablo2/d2networking"
+)
+
+func init() {
+	Register("mem", DialMemory)
+}
+
+// errMemoryTransportClosed is returned by Send/Recv once Close has
+// been called on that end of a MemoryTransport pair. Each end has its
+// own closed state, so closing one end does not close the other.
+var errMemoryTransportClosed = errors.New("d2transport: memory transport closed")
+
+// MemoryTransport implements d2networking.Transport over a pair of Go
+// channels, with no socket involved. It is used for single-player
+// games (where the client and server run in the same process) and for
+// tests, where spinning up a real UDP or WebSocket listener would be
+// unnecessary overhead.
+type MemoryTransport struct {
+	send      chan []byte
+	recv      chan []byte
+	closed    chan struct{}
+	closeOnce sync.Once
+}
+
+// newMemoryPair builds two MemoryTransports wired to each other: what
+// one side sends, the other receives.
+func newMemoryPair() (client, server *MemoryTransport) {
+	clientToServer := make(chan []byte, 64)
+	serverToClient := make(chan []byte, 64)
+
+	client = &MemoryTransport{send: clientToServer, recv: serverToClient, closed: make(chan struct{})}
+	server = &MemoryTransport{send: serverToClient, recv: clientToServer, closed: make(chan struct{})}
+
+	return client, server
+}
+
+// memoryListeners pairs a DialMemory call with the matching
+// ListenMemory call for the same name.
+var memoryListeners = struct {
+	mu      sync.Mutex
+	pending map[string]chan *MemoryTransport
+}{pending: make(map[string]chan *MemoryTransport)}
+
+func memoryListenerChannel(name string) chan *MemoryTransport {
+	memoryListeners.mu.Lock()
+	defer memoryListeners.mu.Unlock()
+
+	ch, ok := memoryListeners.pending[name]
+	if !ok {
+		ch = make(chan *MemoryTransport)
+		memoryListeners.pending[name] = ch
+	}
+
+	return ch
+}
+
+// ListenMemory blocks until a client calls DialMemory(name), then
+// returns the server-side end of that connection. A local GameServer
+// call this once per incoming single-player/test connection.
+func ListenMemory(name string) (*MemoryTransport, error) {
+	return <-memoryListenerChannel(name), nil
+}
+
+// DialMemory connects to a MemoryTransport previously or concurrently
+// registered with ListenMemory(name), blocking until that call is
+// made.
+func DialMemory(name string) (d2networking.Transport, error) {
+	client, server := newMemoryPair()
+	memoryListenerChannel(name) <- server
+
+	return client, nil
+}
+
+// Send delivers data to the other end of the pair.
+func (t *MemoryTransport) Send(data []byte) error {
+	select {
+	case t.send <- data:
+		return nil
+	case <-t.closed:
+		return errMemoryTransportClosed
+	}
+}
+
+// Recv blocks until the other end of the pair sends data.
+func (t *MemoryTransport) Recv() ([]byte, error) {
+	select {
+	case data := <-t.recv:
+		return data, nil
+	case <-t.closed:
+		return nil, errMemoryTransportClosed
+	}
+}
+
+// Close marks the transport closed, unblocking any pending Send/Recv.
+func (t *MemoryTransport) Close() error {
+	t.closeOnce.Do(func() { close(t.closed) })
+	return nil
+}
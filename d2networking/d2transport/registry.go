@@ -0,0 +1,55 @@
+// Package d2transport provides d2networking.Transport implementations
+// and a scheme-based dialer so callers (RemoteClientConnection, the
+// server listener) can be handed a connection string such as
+// "udp://host:6669", "ws://host:6669/ws", or "mem://lobby" without
+// knowing which concrete transport it resolves to.
+package d2transport
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/OpenDiablo2/OpenDiablo2/d2networking"
+)
+
+// defaultScheme is used when connectionString has no "scheme://"
+// prefix, preserving the historical behaviour of treating a bare
+// "host:port" as a UDP address.
+const defaultScheme = "udp"
+
+// dialers maps a connection string scheme to the TransportDialer that
+// handles it. It is populated by the init funcs in udp_transport.go,
+// websocket_transport.go, and memory_transport.go.
+var dialers = map[string]d2networking.TransportDialer{}
+
+// Register associates scheme with dialer, so that Dial("scheme://...")
+// routes to it. Transport implementations call this from an init func.
+func Register(scheme string, dialer d2networking.TransportDialer) {
+	dialers[scheme] = dialer
+}
+
+// Dial parses the scheme off the front of connectionString (defaulting
+// to udp:// if none is present) and dials it with the matching
+// registered TransportDialer.
+func Dial(connectionString string) (d2networking.Transport, error) {
+	scheme, rest := splitScheme(connectionString)
+
+	dialer, ok := dialers[scheme]
+	if !ok {
+		return nil, fmt.Errorf("d2transport: no transport registered for scheme %q", scheme)
+	}
+
+	return dialer(rest)
+}
+
+// splitScheme separates a "scheme://rest" connection string into its
+// scheme and the remainder. A connectionString with no "://" is
+// assumed to be a bare udp address.
+func splitScheme(connectionString string) (scheme, rest string) {
+	idx := strings.Index(connectionString, "://")
+	if idx < 0 {
+		return defaultScheme, connectionString
+	}
+
+	return connectionString[:idx], connectionString[idx+len("://"):]
+}
@@ -0,0 +1,70 @@
+package d2transport
+
+import (
+	"net"
+	"strings"
+
+	"github.com/OpenDiablo2/OpenDiablo2/d2networking"
+)
+
+// defaultUDPPort is appended to a bare host with no port, matching the
+// port the GameServer listens on by default.
+const defaultUDPPort = ":6669"
+
+// maxDatagramSize is the largest single UDP read UDPTransport will
+// attempt. Frames larger than this are expected to have already been
+// fragmented by d2netcodec before being handed to Send.
+const maxDatagramSize = 1500
+
+func init() {
+	Register("udp", DialUDP)
+}
+
+// UDPTransport implements d2networking.Transport over a connected UDP
+// socket. It is the original, LAN-oriented transport.
+type UDPTransport struct {
+	conn *net.UDPConn
+}
+
+// DialUDP connects to address (a bare "host:port", or "host" to use
+// defaultUDPPort) over UDP.
+func DialUDP(address string) (d2networking.Transport, error) {
+	if !strings.Contains(address, ":") {
+		address += defaultUDPPort
+	}
+
+	udpAddress, err := net.ResolveUDPAddr("udp", address)
+	if err != nil {
+		return nil, err
+	}
+
+	conn, err := net.DialUDP("udp", nil, udpAddress)
+	if err != nil {
+		return nil, err
+	}
+
+	return &UDPTransport{conn: conn}, nil
+}
+
+// Send writes data to the connected peer.
+func (t *UDPTransport) Send(data []byte) error {
+	_, err := t.conn.Write(data)
+	return err
+}
+
+// Recv blocks until the next datagram arrives and returns its bytes.
+func (t *UDPTransport) Recv() ([]byte, error) {
+	buffer := make([]byte, maxDatagramSize)
+
+	n, err := t.conn.Read(buffer)
+	if err != nil {
+		return nil, err
+	}
+
+	return buffer[:n], nil
+}
+
+// Close closes the underlying UDP socket.
+func (t *UDPTransport) Close() error {
+	return t.conn.Close()
+}
@@ -0,0 +1,68 @@
+package d2transport
+
+import (
+	"fmt"
+
+	"github.com/OpenDiablo2/OpenDiablo2/d2networking"
+	"github.com/gorilla/websocket"
+)
+
+func init() {
+	Register("ws", DialWebSocket)
+	Register("wss", DialWebSocketTLS)
+}
+
+// WebSocketTransport implements d2networking.Transport over a
+// WebSocket connection. Unlike UDPTransport it can reach a server from
+// inside a browser (e.g. a WASM build of the client) and traverses
+// NATs and firewalls that block raw UDP.
+type WebSocketTransport struct {
+	conn *websocket.Conn
+}
+
+// DialWebSocket connects to a plaintext ws:// URL and wraps the result
+// in a WebSocketTransport. address is the scheme-stripped remainder of
+// the connection string, e.g. "host:6669/ws".
+func DialWebSocket(address string) (d2networking.Transport, error) {
+	return dialWebSocket("ws", address)
+}
+
+// DialWebSocketTLS connects to a TLS-secured wss:// URL and wraps the
+// result in a WebSocketTransport. address is the scheme-stripped
+// remainder of the connection string, e.g. "host:6669/ws".
+func DialWebSocketTLS(address string) (d2networking.Transport, error) {
+	return dialWebSocket("wss", address)
+}
+
+// dialWebSocket restores scheme (which d2transport.Dial stripped off to
+// pick the dialer) onto address before dialing, since gorilla/websocket
+// requires a full URL.
+func dialWebSocket(scheme, address string) (d2networking.Transport, error) {
+	conn, _, err := websocket.DefaultDialer.Dial(fmt.Sprintf("%s://%s", scheme, address), nil)
+	if err != nil {
+		return nil, err
+	}
+
+	return &WebSocketTransport{conn: conn}, nil
+}
+
+// Send writes data as a single binary WebSocket message.
+func (t *WebSocketTransport) Send(data []byte) error {
+	return t.conn.WriteMessage(websocket.BinaryMessage, data)
+}
+
+// Recv blocks until the next binary message arrives and returns its
+// bytes.
+func (t *WebSocketTransport) Recv() ([]byte, error) {
+	_, data, err := t.conn.ReadMessage()
+	if err != nil {
+		return nil, err
+	}
+
+	return data, nil
+}
+
+// Close closes the underlying WebSocket connection.
+func (t *WebSocketTransport) Close() error {
+	return t.conn.Close()
+}
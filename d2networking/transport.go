@@ -0,0 +1,21 @@
+package d2networking
+
+// Transport is a bidirectional, datagram-oriented connection to a
+// single peer. ClientConnection implementations send and receive
+// already-framed bytes (see d2netpacket/d2netcodec) over a Transport
+// without needing to know whether it is backed by UDP, a WebSocket, or
+// an in-process channel.
+type Transport interface {
+	// Send writes one frame to the peer.
+	Send(data []byte) error
+	// Recv blocks until the next frame from the peer is available, or
+	// returns an error once the transport is closed.
+	Recv() ([]byte, error)
+	// Close releases any resources held by the transport.
+	Close() error
+}
+
+// TransportDialer dials connectionString and returns a connected
+// Transport. d2transport.Dial picks the TransportDialer to use based
+// on connectionString's scheme (udp://, ws://, mem://).
+type TransportDialer func(connectionString string) (Transport, error)